@@ -0,0 +1,181 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package bootstrap
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ava-labs/gecko/ids"
+	"github.com/ava-labs/gecko/snow/engine/common/queue"
+	"github.com/ava-labs/gecko/utils/logging"
+)
+
+// fakeJobState is shared by every fakeJob in a single test, since
+// executeWave runs an entire wave's jobs concurrently in separate
+// goroutines: a per-job mutex guards nothing when the map and counter it
+// protects are the same objects shared across jobs.
+type fakeJobState struct {
+	mu       sync.Mutex
+	accepted map[ids.ID]bool
+	executed int
+	// outOfOrder counts Executes that ran before all of the job's parents
+	// were accepted.
+	outOfOrder int
+}
+
+func newFakeJobState() *fakeJobState {
+	return &fakeJobState{accepted: map[ids.ID]bool{}}
+}
+
+func (s *fakeJobState) isAccepted(id ids.ID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted[id]
+}
+
+func (s *fakeJobState) markAccepted(id ids.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accepted[id] = true
+	s.executed++
+}
+
+// fakeJob is a minimal queue.Job used to exercise batchExecutor without a
+// real avalanche.Vertex/vertex.Manager.
+type fakeJob struct {
+	id      ids.ID
+	parents []ids.ID
+
+	state     *fakeJobState
+	failing   bool
+	execDelay chan struct{}
+}
+
+func (j *fakeJob) ID() ids.ID { return j.id }
+
+func (j *fakeJob) MissingDependencies() (ids.Set, error) {
+	missing := ids.Set{}
+	for _, parentID := range j.parents {
+		if !j.state.isAccepted(parentID) {
+			missing.Add(parentID)
+		}
+	}
+	return missing, nil
+}
+
+func (j *fakeJob) Execute() error {
+	if j.execDelay != nil {
+		<-j.execDelay
+	}
+	if j.failing {
+		return errors.New("fakeJob configured to fail")
+	}
+	if deps, _ := j.MissingDependencies(); deps.Len() != 0 {
+		j.state.mu.Lock()
+		j.state.outOfOrder++
+		j.state.mu.Unlock()
+	}
+
+	j.state.markAccepted(j.id)
+	return nil
+}
+
+func (j *fakeJob) Bytes() []byte { return nil }
+
+func newTestBatchExecutor(t *testing.T, numWorkers int) *batchExecutor {
+	t.Helper()
+	b, err := newBatchExecutor(logging.NoLog{}, numWorkers, "bootstrap_batch_test", prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("unexpected error creating batchExecutor: %s", err)
+	}
+	return b
+}
+
+// TestExecuteBatchWaveLayering verifies that a chain of dependent jobs is
+// executed one wave at a time, in dependency order, rather than all at
+// once.
+func TestExecuteBatchWaveLayering(t *testing.T) {
+	b := newTestBatchExecutor(t, 4)
+
+	state := newFakeJobState()
+
+	root := &fakeJob{id: ids.ID{1}, state: state}
+	childA := &fakeJob{id: ids.ID{2}, parents: []ids.ID{root.id}, state: state}
+	childB := &fakeJob{id: ids.ID{3}, parents: []ids.ID{root.id}, state: state}
+	grandchild := &fakeJob{id: ids.ID{4}, parents: []ids.ID{childA.id, childB.id}, state: state}
+
+	jobs := []queue.Job{root, childA, childB, grandchild}
+	if err := b.ExecuteBatch(jobs); err != nil {
+		t.Fatalf("unexpected error executing batch: %s", err)
+	}
+
+	if state.executed != len(jobs) {
+		t.Fatalf("expected all %d jobs to be executed, got %d", len(jobs), state.executed)
+	}
+	if state.outOfOrder != 0 {
+		t.Fatalf("expected every job to run after its parents were accepted, got %d out-of-order executions", state.outOfOrder)
+	}
+	for _, job := range jobs {
+		if !state.isAccepted(job.ID()) {
+			t.Fatalf("expected job %s to be accepted", job.ID())
+		}
+	}
+}
+
+// TestExecuteBatchConcurrentWaveFailureFallsBack verifies that a failure
+// within a concurrently-executed wave falls back to sequential execution
+// for the remaining jobs, rather than aborting the whole batch.
+func TestExecuteBatchConcurrentWaveFailureFallsBack(t *testing.T) {
+	b := newTestBatchExecutor(t, 4)
+
+	state := newFakeJobState()
+
+	root := &fakeJob{id: ids.ID{1}, state: state}
+	ok := &fakeJob{id: ids.ID{2}, parents: []ids.ID{root.id}, state: state}
+	bad := &fakeJob{id: ids.ID{3}, parents: []ids.ID{root.id}, state: state, failing: true}
+	dependent := &fakeJob{id: ids.ID{4}, parents: []ids.ID{ok.id}, state: state}
+
+	jobs := []queue.Job{root, ok, bad, dependent}
+	err := b.ExecuteBatch(jobs)
+	if err == nil {
+		t.Fatal("expected ExecuteBatch to return the error from the failing job")
+	}
+
+	// The sequential fallback should still have made progress on every job
+	// that didn't depend on the failing one.
+	if !state.isAccepted(root.id) {
+		t.Fatal("expected root to have been accepted before the failing wave")
+	}
+	if !state.isAccepted(ok.id) {
+		t.Fatal("expected the sibling of the failing job to have been accepted by the sequential fallback")
+	}
+	if state.isAccepted(bad.id) {
+		t.Fatal("expected the failing job to never be marked accepted")
+	}
+	if !state.isAccepted(dependent.id) {
+		t.Fatal("expected the job that depends only on the sibling to have been accepted by the sequential fallback")
+	}
+}
+
+// TestExecuteBatchSequentialFallbackOnStall verifies that ExecuteBatch
+// reports an error, rather than hanging or silently dropping jobs, when a
+// job's dependency never becomes accepted (e.g. it's missing from the
+// batch entirely).
+func TestExecuteBatchSequentialFallbackOnStall(t *testing.T) {
+	b := newTestBatchExecutor(t, 4)
+
+	state := newFakeJobState()
+
+	// orphan depends on a parent that is never part of the batch, so it can
+	// never be scheduled into any wave.
+	orphan := &fakeJob{id: ids.ID{1}, parents: []ids.ID{{99}}, state: state}
+
+	if err := b.ExecuteBatch([]queue.Job{orphan}); err == nil {
+		t.Fatal("expected ExecuteBatch to report a stall when a dependency never becomes accepted")
+	}
+}
@@ -21,6 +21,54 @@ type vtxParser struct {
 	log                     logging.Logger
 	numAccepted, numDropped prometheus.Counter
 	mgr                     vertex.Manager
+
+	// batcher, if non-nil, is used by ExecuteBatch to accept a frontier of
+	// jobs in dependency-ordered waves instead of one at a time. It's
+	// opt-in (via newVtxParserWithBatching) so that callers which only ever
+	// hand jobs to the queue one at a time keep today's serial behavior.
+	batcher *batchExecutor
+}
+
+// newVtxParserWithBatching returns a vtxParser whose ExecuteBatch accepts
+// vertices concurrently in dependency-ordered waves, falling back to
+// sequential execution whenever a wave can't make progress or fails. This
+// is the entry point the bootstrapper's queue driver should use once it
+// gathers a vertex frontier, in place of calling Execute on each job it
+// gets back from Parse one at a time.
+func newVtxParserWithBatching(
+	log logging.Logger,
+	numAccepted, numDropped prometheus.Counter,
+	mgr vertex.Manager,
+	numWorkers int,
+	namespace string,
+	registerer prometheus.Registerer,
+) (*vtxParser, error) {
+	batcher, err := newBatchExecutor(log, numWorkers, namespace, registerer)
+	if err != nil {
+		return nil, err
+	}
+	return &vtxParser{
+		log:         log,
+		numAccepted: numAccepted,
+		numDropped:  numDropped,
+		mgr:         mgr,
+		batcher:     batcher,
+	}, nil
+}
+
+// ExecuteBatch executes [jobs] in dependency-ordered waves if this parser
+// was constructed with a batcher (see newVtxParserWithBatching), falling
+// back to the serial per-job Execute path otherwise.
+func (p *vtxParser) ExecuteBatch(jobs []queue.Job) error {
+	if p.batcher != nil {
+		return p.batcher.ExecuteBatch(jobs)
+	}
+	for _, job := range jobs {
+		if err := job.Execute(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (p *vtxParser) Parse(vtxBytes []byte) (queue.Job, error) {
@@ -97,4 +145,4 @@ func (v *vertexJob) Execute() error {
 	return nil
 }
 
-func (v *vertexJob) Bytes() []byte { return v.vtx.Bytes() }
\ No newline at end of file
+func (v *vertexJob) Bytes() []byte { return v.vtx.Bytes() }
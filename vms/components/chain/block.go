@@ -0,0 +1,47 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/snow/consensus/snowman"
+)
+
+// BlockWrapper wraps a snowman.Block to manage the caching of decided and
+// non-decided blocks with their decision status, so that their wrapped
+// versions are returned consistently by [Cache].
+type BlockWrapper struct {
+	snowman.Block
+
+	cache *Cache
+}
+
+// Accept accepts the underlying block and updates the caches held by
+// [cache] so that subsequent lookups observe this block as decided.
+func (bw *BlockWrapper) Accept() error {
+	if err := bw.Block.Accept(); err != nil {
+		return fmt.Errorf("failed to accept block %s due to %w", bw.ID(), err)
+	}
+
+	delete(bw.cache.verifiedBlocks, bw.ID())
+	bw.cache.lastAcceptedBlock = bw
+	bw.cache.decidedBlocks.Put(bw.ID(), bw)
+	bw.cache.acceptedCache.Put(heightKey(bw.Height()), bw.ID())
+	bw.cache.dispatchAccepted(bw)
+	return nil
+}
+
+// Reject rejects the underlying block and updates the caches held by
+// [cache] so that subsequent lookups observe this block as decided.
+func (bw *BlockWrapper) Reject() error {
+	if err := bw.Block.Reject(); err != nil {
+		return fmt.Errorf("failed to reject block %s due to %w", bw.ID(), err)
+	}
+
+	delete(bw.cache.verifiedBlocks, bw.ID())
+	bw.cache.decidedBlocks.Put(bw.ID(), bw)
+	bw.cache.dispatchRejected(bw)
+	return nil
+}
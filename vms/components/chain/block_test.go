@@ -0,0 +1,60 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+)
+
+// TestBlockWrapperAcceptRemovesFromVerifiedBlocks verifies that accepting a
+// block removes it from verifiedBlocks, since an accepted block is decided
+// rather than in consensus; otherwise verifiedBlocks grows unboundedly.
+func TestBlockWrapperAcceptRemovesFromVerifiedBlocks(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   10,
+		LastAcceptedBlock:   genesis,
+	})
+
+	blk := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	wrapped := &BlockWrapper{Block: blk, cache: c}
+	c.verifiedBlocks[blk.id] = wrapped
+
+	if err := wrapped.Accept(); err != nil {
+		t.Fatalf("unexpected error accepting block: %s", err)
+	}
+	if _, ok := c.verifiedBlocks[blk.id]; ok {
+		t.Fatalf("expected accepted block to be removed from verifiedBlocks")
+	}
+}
+
+// TestBlockWrapperRejectRemovesFromVerifiedBlocks mirrors the Accept case
+// for Reject.
+func TestBlockWrapperRejectRemovesFromVerifiedBlocks(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   10,
+		LastAcceptedBlock:   genesis,
+	})
+
+	blk := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	wrapped := &BlockWrapper{Block: blk, cache: c}
+	c.verifiedBlocks[blk.id] = wrapped
+
+	if err := wrapped.Reject(); err != nil {
+		t.Fatalf("unexpected error rejecting block: %s", err)
+	}
+	if _, ok := c.verifiedBlocks[blk.id]; ok {
+		t.Fatalf("expected rejected block to be removed from verifiedBlocks")
+	}
+}
@@ -0,0 +1,98 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/ava-labs/avalanchego/ids"
+)
+
+const (
+	// defaultBloomSize is the counter array length used when a Config
+	// doesn't specify one.
+	defaultBloomSize = 1 << 16
+	// defaultBloomHashes is the number of independent counter slots touched
+	// per ID when a Config doesn't specify one.
+	defaultBloomHashes = 4
+)
+
+// countingBloomFilter is a small counting Bloom filter keyed on ids.ID. It
+// supports Add/Remove/Contains at O(1) memory per entry regardless of how
+// many distinct IDs have been added, trading a tunable false-positive rate
+// for the unbounded capacity that a size-bounded LRU doesn't have. As long
+// as every Remove is balanced by a prior Add of the same ID and no counter
+// has saturated at 255, Contains never reports an added ID as absent.
+type countingBloomFilter struct {
+	counters  []uint8
+	numHashes int
+}
+
+func newCountingBloomFilter(size, numHashes int) *countingBloomFilter {
+	if size <= 0 {
+		size = defaultBloomSize
+	}
+	if numHashes <= 0 {
+		numHashes = defaultBloomHashes
+	}
+	return &countingBloomFilter{
+		counters:  make([]uint8, size),
+		numHashes: numHashes,
+	}
+}
+
+// indices returns the [numHashes] counter slots touched by [id], derived
+// from two independent 8-byte windows of the ID via double hashing
+// (Kirsch-Mitzenmacher), avoiding the need for a family of hash functions.
+func (f *countingBloomFilter) indices(id ids.ID) []uint64 {
+	h1 := binary.LittleEndian.Uint64(id[0:8])
+	h2 := binary.LittleEndian.Uint64(id[8:16])
+	size := uint64(len(f.counters))
+
+	idx := make([]uint64, f.numHashes)
+	for i := 0; i < f.numHashes; i++ {
+		idx[i] = (h1 + uint64(i)*h2) % size
+	}
+	return idx
+}
+
+// Add records one occurrence of [id].
+func (f *countingBloomFilter) Add(id ids.ID) {
+	for _, i := range f.indices(id) {
+		if f.counters[i] < math.MaxUint8 {
+			f.counters[i]++
+		}
+	}
+}
+
+// Remove undoes one occurrence of [id] previously recorded by Add. Calls to
+// Remove must be balanced with a prior Add of the same [id], or counters
+// shared with still-present IDs can be driven to zero early, reintroducing
+// a false negative.
+func (f *countingBloomFilter) Remove(id ids.ID) {
+	for _, i := range f.indices(id) {
+		if f.counters[i] > 0 {
+			f.counters[i]--
+		}
+	}
+}
+
+// Contains reports whether [id] may have been added. A true result can be a
+// false positive; a false result is always exact.
+func (f *countingBloomFilter) Contains(id ids.ID) bool {
+	for _, i := range f.indices(id) {
+		if f.counters[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Reset drains every counter back to zero.
+func (f *countingBloomFilter) Reset() {
+	for i := range f.counters {
+		f.counters[i] = 0
+	}
+}
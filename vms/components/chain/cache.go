@@ -4,8 +4,11 @@
 package chain
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/ava-labs/avalanchego/cache"
 	"github.com/ava-labs/avalanchego/cache/metercacher"
@@ -39,6 +42,11 @@ type Cache struct {
 	// getStatus returns the status of the block
 	getStatus func(snowman.Block) (choices.Status, error)
 
+	// getBlockIDAtHeight, if non-nil, returns the accepted blockID at a
+	// given height. It backs both produceGetStatus and LastAcceptedSince's
+	// fallback for heights that have been evicted from [acceptedCache].
+	getBlockIDAtHeight func(uint64) (ids.ID, error)
+
 	// verifiedBlocks is a map of blocks that have been verified and are
 	// therefore currently in consensus.
 	verifiedBlocks map[ids.ID]*BlockWrapper
@@ -51,20 +59,48 @@ type Cache struct {
 	unverifiedBlocks cache.Cacher
 	// missingBlocks is an LRU cache of missing blocks
 	// Every value in [missingBlocks] is an empty struct.
-	missingBlocks     cache.Cacher
+	missingBlocks cache.Cacher
+	// acceptedCache is an LRU cache of height -> accepted blockID, keyed
+	// via [heightKey]. It lets [produceGetStatus] resolve the status of
+	// any already-accepted height without going back to the VM.
+	acceptedCache     cache.Cacher
 	lastAcceptedBlock *BlockWrapper
+
+	// onReorg, if non-nil, is invoked with the new tip at the end of a
+	// successful call to Reorg.
+	onReorg func(snowman.Block)
+
+	// subsLock guards acceptedSubs, rejectedSubs and droppedSubEvents.
+	subsLock         sync.RWMutex
+	acceptedSubs     []*Subscription
+	rejectedSubs     []*Subscription
+	droppedSubEvents uint64
 }
 
 // Config defines all of the parameters necessary to initialize State
 type Config struct {
 	// Cache configuration:
-	DecidedCacheSize, MissingCacheSize, UnverifiedCacheSize int
+	DecidedCacheSize, MissingCacheSize, UnverifiedCacheSize, AcceptedCacheSize int
+
+	// MissingBloomSize and MissingBloomHashes size the counting Bloom
+	// filter backing the missing-block negative-lookup cache. If either is
+	// <= 0, a reasonable default is used.
+	MissingBloomSize, MissingBloomHashes int
+	// MissingQuiesceDelay is how long the set of outstanding VM lookups for
+	// missing blocks must stay at zero before the Bloom filter backing the
+	// missing-block cache is drained. If <= 0, a reasonable default is used.
+	MissingQuiesceDelay time.Duration
 
 	LastAcceptedBlock  snowman.Block
 	GetBlock           func(ids.ID) (snowman.Block, error)
 	UnmarshalBlock     func([]byte) (snowman.Block, error)
 	BuildBlock         func() (snowman.Block, error)
 	GetBlockIDAtHeight func(uint64) (ids.ID, error)
+
+	// OnReorg, if non-nil, is called with the new last accepted block
+	// every time [Cache.Reorg] rewinds the canonical chain, so that the
+	// VM can replay transactions on top of the new tip.
+	OnReorg func(snowman.Block)
 }
 
 // Block is an interface wrapping the normal snowman.Block interface to be used in
@@ -75,6 +111,14 @@ type Block interface {
 	SetStatus(choices.Status)
 }
 
+// heightKey packs [height] into the low 8 bytes of an ids.ID so that the
+// height->acceptedID index can be stored in an ordinary ids.ID-keyed cache.
+func heightKey(height uint64) ids.ID {
+	key := ids.ID{}
+	binary.BigEndian.PutUint64(key[:8], height)
+	return key
+}
+
 // produceGetStatus creates a getStatus function that infers the status of a block by using a function
 // passed in from the VM that gets the block ID at a specific height. It is assumed that for any height
 // less than or equal to the last accepted block, getBlockIDAtHeight returns the accepted blockID at
@@ -92,11 +136,18 @@ func produceGetStatus(c *Cache, getBlockIDAtHeight func(uint64) (ids.ID, error))
 			return choices.Processing, nil
 		}
 
-		acceptedID, err := getBlockIDAtHeight(blkHeight)
-		if err != nil {
-			return choices.Unknown, fmt.Errorf("failed to get accepted blkID at height %d", blkHeight)
+		blkID := blk.ID()
+		key := heightKey(blkHeight)
+		acceptedID, cached := c.acceptedCache.Get(key)
+		if !cached {
+			var err error
+			acceptedID, err = getBlockIDAtHeight(blkHeight)
+			if err != nil {
+				return choices.Unknown, fmt.Errorf("failed to get accepted blkID at height %d", blkHeight)
+			}
+			c.acceptedCache.Put(key, acceptedID)
 		}
-		if acceptedID == blk.ID() {
+		if acceptedID.(ids.ID) == blkID {
 			internalBlk.SetStatus(choices.Accepted)
 			return choices.Accepted, nil
 		}
@@ -110,13 +161,16 @@ func NewCache(config *Config) *Cache {
 	c := &Cache{
 		verifiedBlocks:   make(map[ids.ID]*BlockWrapper),
 		decidedBlocks:    &cache.LRU{Size: config.DecidedCacheSize},
-		missingBlocks:    &cache.LRU{Size: config.MissingCacheSize},
+		missingBlocks:    newMissingBlockCache(config.MissingCacheSize, config.MissingBloomSize, config.MissingBloomHashes, config.MissingQuiesceDelay, nil),
 		unverifiedBlocks: &cache.LRU{Size: config.UnverifiedCacheSize},
+		acceptedCache:    &cache.LRU{Size: config.AcceptedCacheSize},
 		getBlock:         config.GetBlock,
 		unmarshalBlock:   config.UnmarshalBlock,
 		buildBlock:       config.BuildBlock,
 		getStatus:        func(blk snowman.Block) (choices.Status, error) { return blk.Status(), nil },
 	}
+	c.onReorg = config.OnReorg
+	c.getBlockIDAtHeight = config.GetBlockIDAtHeight
 	if config.GetBlockIDAtHeight != nil {
 		c.getStatus = produceGetStatus(c, config.GetBlockIDAtHeight)
 	}
@@ -125,6 +179,7 @@ func NewCache(config *Config) *Cache {
 		cache: c,
 	}
 	c.decidedBlocks.Put(config.LastAcceptedBlock.ID(), c.lastAcceptedBlock)
+	c.acceptedCache.Put(heightKey(config.LastAcceptedBlock.Height()), config.LastAcceptedBlock.ID())
 	return c
 }
 
@@ -141,10 +196,18 @@ func NewMeteredCache(
 	if err != nil {
 		return nil, err
 	}
+	missingBloomFalsePositives := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "missing_cache_bloom_false_positives",
+		Help:      "number of times the missing-block Bloom filter shadowed a block that the VM actually produced",
+	})
+	if err := registerer.Register(missingBloomFalsePositives); err != nil {
+		return nil, fmt.Errorf("failed to register missing_cache_bloom_false_positives statistics: %w", err)
+	}
 	missingCache, err := metercacher.New(
 		fmt.Sprintf("%s_missing_cache", namespace),
 		registerer,
-		&cache.LRU{Size: config.MissingCacheSize},
+		newMissingBlockCache(config.MissingCacheSize, config.MissingBloomSize, config.MissingBloomHashes, config.MissingQuiesceDelay, missingBloomFalsePositives),
 	)
 	if err != nil {
 		return nil, err
@@ -157,15 +220,26 @@ func NewMeteredCache(
 	if err != nil {
 		return nil, err
 	}
+	acceptedCache, err := metercacher.New(
+		fmt.Sprintf("%s_accepted_cache", namespace),
+		registerer,
+		&cache.LRU{Size: config.AcceptedCacheSize},
+	)
+	if err != nil {
+		return nil, err
+	}
 	c := &Cache{
 		verifiedBlocks:   make(map[ids.ID]*BlockWrapper),
 		decidedBlocks:    decidedCache,
 		missingBlocks:    missingCache,
 		unverifiedBlocks: unverifiedCache,
+		acceptedCache:    acceptedCache,
 		getBlock:         config.GetBlock,
 		unmarshalBlock:   config.UnmarshalBlock,
 		buildBlock:       config.BuildBlock,
 	}
+	c.onReorg = config.OnReorg
+	c.getBlockIDAtHeight = config.GetBlockIDAtHeight
 	if config.GetBlockIDAtHeight != nil {
 		c.getStatus = produceGetStatus(c, config.GetBlockIDAtHeight)
 	}
@@ -174,6 +248,7 @@ func NewMeteredCache(
 		cache: c,
 	}
 	c.decidedBlocks.Put(config.LastAcceptedBlock.ID(), c.lastAcceptedBlock)
+	c.acceptedCache.Put(heightKey(config.LastAcceptedBlock.Height()), config.LastAcceptedBlock.ID())
 	return c, nil
 }
 
@@ -182,6 +257,14 @@ func (c *Cache) FlushCaches() {
 	c.decidedBlocks.Flush()
 	c.missingBlocks.Flush()
 	c.unverifiedBlocks.Flush()
+	c.acceptedCache.Flush()
+}
+
+// fetchTracker is implemented by missing-block caches that need to know
+// when the set of outstanding VM lookups quiesces.
+type fetchTracker interface {
+	beginFetch()
+	endFetch()
 }
 
 // GetBlock returns the BlockWrapper as snowman.Block corresponding to [blkID]
@@ -194,6 +277,11 @@ func (c *Cache) GetBlock(blkID ids.ID) (snowman.Block, error) {
 		return nil, ErrBlockNotFound
 	}
 
+	if tracker, ok := c.missingBlocks.(fetchTracker); ok {
+		tracker.beginFetch()
+		defer tracker.endFetch()
+	}
+
 	blk, err := c.getBlock(blkID)
 	if err == ErrBlockNotFound {
 		c.missingBlocks.Put(blkID, struct{}{})
@@ -321,4 +409,4 @@ func (c *Cache) LastAcceptedBlock() *BlockWrapper {
 // LastAcceptedBlockInternal returns the internal snowman.Block that was last accepted
 func (c *Cache) LastAcceptedBlockInternal() snowman.Block {
 	return c.LastAcceptedBlock().Block
-}
\ No newline at end of file
+}
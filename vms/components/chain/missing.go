@@ -0,0 +1,146 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ava-labs/avalanchego/cache"
+	"github.com/ava-labs/avalanchego/ids"
+)
+
+// defaultMissingQuiesceDelay is used when a Config doesn't specify
+// MissingQuiesceDelay. It's chosen to comfortably outlast the gap between
+// two back-to-back sequential fetches, so the Bloom filter isn't drained
+// the instant a single fetch finishes.
+const defaultMissingQuiesceDelay = 2 * time.Second
+
+// missingBlockCache is a two-tier negative-lookup cache of block IDs the VM
+// has reported as missing. [recent] is a small LRU that answers the common
+// case exactly; [filter] is a counting Bloom filter that absorbs everything
+// [recent] has since evicted, at O(1) memory per ID, so that a genuinely
+// missing block queried repeatedly during bootstrap fan-out doesn't keep
+// round-tripping to the VM once it falls out of the LRU.
+//
+// A Bloom hit can be a false positive, but that's safe: ParseBlock and
+// BuildBlock always call Evict on a blkID the moment the VM actually
+// produces it, clearing both tiers, so a real block can never stay
+// permanently shadowed. [recent]'s hit/miss counts are exposed the same
+// way every other cache in [Cache] is, via metercacher; falsePositives is a
+// dedicated counter for the cases Evict catches a stale Bloom shadow.
+type missingBlockCache struct {
+	recent cache.Cacher
+	filter *countingBloomFilter
+
+	mu           sync.Mutex
+	outstanding  int
+	quiesceDelay time.Duration
+	quiesceTimer *time.Timer
+
+	falsePositives prometheus.Counter
+}
+
+func newMissingBlockCache(recentSize, bloomSize, bloomHashes int, quiesceDelay time.Duration, falsePositives prometheus.Counter) *missingBlockCache {
+	if quiesceDelay <= 0 {
+		quiesceDelay = defaultMissingQuiesceDelay
+	}
+	return &missingBlockCache{
+		recent:         &cache.LRU{Size: recentSize},
+		filter:         newCountingBloomFilter(bloomSize, bloomHashes),
+		quiesceDelay:   quiesceDelay,
+		falsePositives: falsePositives,
+	}
+}
+
+// Put records [key] as missing in both tiers.
+func (m *missingBlockCache) Put(key ids.ID, value interface{}) {
+	m.recent.Put(key, value)
+	m.filter.Add(key)
+}
+
+// Get reports whether [key] is known, or probably, missing.
+func (m *missingBlockCache) Get(key ids.ID) (interface{}, bool) {
+	if v, ok := m.recent.Get(key); ok {
+		return v, true
+	}
+	if m.filter.Contains(key) {
+		return struct{}{}, true
+	}
+	return nil, false
+}
+
+// Evict clears [key] from both tiers. It is called once the VM has
+// successfully parsed or built a block previously believed missing.
+func (m *missingBlockCache) Evict(key ids.ID) {
+	_, recentHit := m.recent.Get(key)
+	bloomHit := m.filter.Contains(key)
+	if bloomHit && !recentHit && m.falsePositives != nil {
+		// Only the probabilistic tier reported [key] as missing, for a
+		// block the VM has now produced. This counts both a genuine Bloom
+		// false positive and a key that was Put and has since fallen out
+		// of [recent]; Evict cannot tell the two apart.
+		m.falsePositives.Inc()
+	}
+
+	m.recent.Evict(key)
+	if bloomHit {
+		// Only Remove a key the filter reports. The Bloom filter's slots
+		// are shared across unrelated IDs, and Evict is called for every
+		// block the VM ever produces, not just ones that were actually
+		// missing, so this skips the common never-Add-ed case. A false
+		// positive (a key never Add-ed whose slots are all set by other
+		// IDs) is still Removed: that decrements slots still-missing IDs
+		// depend on and can make the filter report one of them as absent,
+		// so its next lookup goes to the VM.
+		m.filter.Remove(key)
+	}
+}
+
+// Flush clears both tiers completely.
+func (m *missingBlockCache) Flush() {
+	m.recent.Flush()
+	m.filter.Reset()
+}
+
+// beginFetch and endFetch bracket a VM lookup for a key that wasn't found
+// in either tier. Once the set of outstanding lookups has been at zero for
+// [quiesceDelay] - not merely transiently between two back-to-back fetches,
+// which would otherwise drain the filter after every sequential miss - the
+// Bloom filter is drained: any entries it's still holding only reflect
+// blocks that are still genuinely missing, since everything produced in
+// the meantime would have gone through Evict.
+func (m *missingBlockCache) beginFetch() {
+	m.mu.Lock()
+	m.outstanding++
+	m.mu.Unlock()
+}
+
+func (m *missingBlockCache) endFetch() {
+	m.mu.Lock()
+	m.outstanding--
+	quiesced := m.outstanding <= 0
+	if quiesced {
+		if m.quiesceTimer != nil {
+			m.quiesceTimer.Stop()
+		}
+		m.quiesceTimer = time.AfterFunc(m.quiesceDelay, m.drainIfStillQuiesced)
+	}
+	m.mu.Unlock()
+}
+
+// drainIfStillQuiesced is the quiesceTimer callback. It re-checks
+// [outstanding] at fire time, since a new fetch may have started during
+// the delay.
+func (m *missingBlockCache) drainIfStillQuiesced() {
+	m.mu.Lock()
+	quiesced := m.outstanding <= 0
+	m.mu.Unlock()
+
+	if quiesced {
+		m.filter.Reset()
+	}
+}
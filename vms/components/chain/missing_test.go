@@ -0,0 +1,106 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+)
+
+// TestMissingBlockCacheSurvivesLRUEviction verifies that an ID the small
+// recency LRU has evicted is still reported as (probably) missing by the
+// Bloom tier, and that Evict correctly clears both tiers once the VM
+// produces the block.
+func TestMissingBlockCacheSurvivesLRUEviction(t *testing.T) {
+	m := newMissingBlockCache(1 /*recentSize*/, 1<<12, 4, time.Second, nil)
+
+	missingID := ids.ID{1}
+	m.Put(missingID, struct{}{})
+
+	// Evict [missingID] from the recency tier by pushing another entry
+	// through a size-1 LRU.
+	m.Put(ids.ID{2}, struct{}{})
+	if _, ok := m.recent.Get(missingID); ok {
+		t.Fatal("expected missingID to have been evicted from the recency LRU")
+	}
+
+	if _, ok := m.Get(missingID); !ok {
+		t.Fatal("expected the Bloom tier to still report missingID as missing")
+	}
+
+	// The VM has now produced the block; Evict should clear both tiers.
+	m.Evict(missingID)
+	if _, ok := m.Get(missingID); ok {
+		t.Fatal("expected missingID to no longer be reported as missing after Evict")
+	}
+}
+
+// TestMissingBlockCacheNoInstantDrainOnSequentialFetch verifies that a
+// single, non-overlapping beginFetch/endFetch pair - the common case for
+// sequential fetches - does not instantly drain the Bloom filter, since
+// that would wipe out the entry just Put in the same call.
+func TestMissingBlockCacheNoInstantDrainOnSequentialFetch(t *testing.T) {
+	m := newMissingBlockCache(1, 1<<12, 4, time.Hour, nil)
+
+	missingID := ids.ID{1}
+	m.Put(missingID, struct{}{})
+	m.recent.Evict(missingID)
+
+	m.beginFetch()
+	m.endFetch()
+
+	if !m.filter.Contains(missingID) {
+		t.Fatal("expected the Bloom filter to survive a single quiesced fetch, not drain instantly")
+	}
+}
+
+// TestMissingBlockCacheRebuildOnQuiesce verifies that the Bloom filter is
+// drained once the set of outstanding fetches has been at zero for the
+// full quiesce delay.
+func TestMissingBlockCacheRebuildOnQuiesce(t *testing.T) {
+	m := newMissingBlockCache(1, 1<<12, 4, 20*time.Millisecond, nil)
+
+	missingID := ids.ID{1}
+	m.Put(missingID, struct{}{})
+	m.recent.Evict(missingID)
+
+	if !m.filter.Contains(missingID) {
+		t.Fatal("expected the Bloom filter to still contain missingID")
+	}
+
+	m.beginFetch()
+	m.endFetch()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if !m.filter.Contains(missingID) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("expected the Bloom filter to be drained once fetches stayed quiesced past the delay")
+}
+
+// TestMissingBlockCacheQuiesceTimerResetByNewFetch verifies that a new
+// fetch starting during the quiesce delay cancels the pending drain, so
+// the filter isn't wiped out from under a just-started fetch.
+func TestMissingBlockCacheQuiesceTimerResetByNewFetch(t *testing.T) {
+	m := newMissingBlockCache(1, 1<<12, 4, 30*time.Millisecond, nil)
+
+	missingID := ids.ID{1}
+	m.Put(missingID, struct{}{})
+	m.recent.Evict(missingID)
+
+	m.beginFetch()
+	m.endFetch()
+	m.beginFetch()
+
+	time.Sleep(60 * time.Millisecond)
+	if !m.filter.Contains(missingID) {
+		t.Fatal("expected the Bloom filter to survive while a fetch is outstanding")
+	}
+	m.endFetch()
+}
@@ -0,0 +1,120 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+	"github.com/ava-labs/avalanchego/snow/consensus/snowman"
+)
+
+// Reject moves [blkID] out of [verifiedBlocks] and into [decidedBlocks] with
+// status Rejected. It is a no-op if [blkID] is not currently in consensus,
+// since decided blocks are already reflected by [decidedBlocks].
+func (c *Cache) Reject(blkID ids.ID) error {
+	blk, ok := c.verifiedBlocks[blkID]
+	if !ok {
+		return nil
+	}
+	delete(c.verifiedBlocks, blkID)
+
+	if err := blk.Reject(); err != nil {
+		return err
+	}
+	c.acceptedCache.Evict(heightKey(blk.Height()))
+	return nil
+}
+
+// rejectDecided marks the already-decided block [blkID] as rejected in
+// [decidedBlocks], without re-running Accept/Reject side effects such as
+// dispatching to subscribers. It is used by Reorg to invalidate blocks on
+// the stale accepted chain that are no longer resident in [verifiedBlocks]
+// (the normal state for anything that was already decided).
+func (c *Cache) rejectDecided(blkID ids.ID) (*BlockWrapper, error) {
+	delete(c.verifiedBlocks, blkID)
+
+	cached, ok := c.getCachedBlock(blkID)
+	if !ok {
+		var err error
+		cached, err = c.GetBlock(blkID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch stale accepted block %s: %w", blkID, err)
+		}
+	}
+	wrapped, ok := cached.(*BlockWrapper)
+	if !ok {
+		return nil, fmt.Errorf("expected cached block %s to be a *BlockWrapper but found %T", blkID, cached)
+	}
+	internalBlk, ok := wrapped.Block.(Block)
+	if !ok {
+		return nil, fmt.Errorf("expected block %s to match chain Block interface but found block of type %T", blkID, wrapped.Block)
+	}
+	internalBlk.SetStatus(choices.Rejected)
+	c.decidedBlocks.Put(blkID, wrapped)
+	return wrapped, nil
+}
+
+// Reorg rewinds the accepted chain back to [fromHeight] and sets [newTip] as
+// the new last accepted block. Every verified block at or above [fromHeight]
+// other than [newTip] itself is rejected, every block on the superseded
+// accepted chain from the old tip down to [fromHeight] is invalidated in
+// [decidedBlocks] even if it is no longer resident in [verifiedBlocks], and
+// every height->acceptedID entry at or above [fromHeight] is evicted so that
+// stale lookups fall back to the VM. [newTip] must already be verified by the
+// caller before calling Reorg; this method only updates the cache's
+// bookkeeping.
+//
+// If [onReorg] was configured, it is invoked with [newTip] once the cache has
+// been rewound, so that VMs (e.g. to replay transactions) can bring their own
+// state in line with the new canonical chain.
+func (c *Cache) Reorg(fromHeight uint64, newTip snowman.Block) error {
+	if newTip.Height() < fromHeight {
+		return fmt.Errorf("reorg target height %d is below the reorg point %d", newTip.Height(), fromHeight)
+	}
+
+	oldTip := c.lastAcceptedBlock
+	oldHeight := oldTip.Height()
+	for height := fromHeight; height <= oldHeight; height++ {
+		c.acceptedCache.Evict(heightKey(height))
+	}
+
+	newTipID := newTip.ID()
+	for blkID, blk := range c.verifiedBlocks {
+		if blkID == newTipID || blk.Height() < fromHeight {
+			continue
+		}
+		if err := c.Reject(blkID); err != nil {
+			return err
+		}
+	}
+
+	if fromHeight <= oldHeight {
+		staleID := oldTip.ID()
+		for height := oldHeight; ; height-- {
+			wrapped, err := c.rejectDecided(staleID)
+			if err != nil {
+				return fmt.Errorf("failed to invalidate stale accepted chain down to height %d: %w", fromHeight, err)
+			}
+			if height == fromHeight {
+				break
+			}
+			staleID = wrapped.Parent()
+		}
+	}
+
+	wrappedTip := &BlockWrapper{
+		Block: newTip,
+		cache: c,
+	}
+	c.decidedBlocks.Put(newTipID, wrappedTip)
+	c.acceptedCache.Put(heightKey(newTip.Height()), newTipID)
+	c.lastAcceptedBlock = wrappedTip
+
+	if c.onReorg != nil {
+		c.onReorg(wrappedTip)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+)
+
+// testBlock is a minimal implementation of the chain.Block interface used
+// to exercise Cache.Reject and Cache.Reorg without a real VM.
+type testBlock struct {
+	id     ids.ID
+	parent ids.ID
+	height uint64
+	status choices.Status
+	bytes  []byte
+}
+
+func (b *testBlock) ID() ids.ID                 { return b.id }
+func (b *testBlock) Parent() ids.ID             { return b.parent }
+func (b *testBlock) Height() uint64             { return b.height }
+func (b *testBlock) Bytes() []byte              { return b.bytes }
+func (b *testBlock) Status() choices.Status     { return b.status }
+func (b *testBlock) SetStatus(s choices.Status) { b.status = s }
+func (b *testBlock) Verify() error              { return nil }
+func (b *testBlock) Accept() error              { b.status = choices.Accepted; return nil }
+func (b *testBlock) Reject() error              { b.status = choices.Rejected; return nil }
+
+// TestReorg exercises a deep reorg, ensuring that verified blocks on the
+// stale fork are rejected and cache lookups reflect the new tip.
+func TestReorg(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   10,
+		LastAcceptedBlock:   genesis,
+	})
+
+	// Build up a short accepted chain: genesis -> a1 -> a2 -> a3.
+	a1 := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	a2 := &testBlock{id: ids.ID{3}, parent: a1.id, height: 2, status: choices.Processing}
+	a3 := &testBlock{id: ids.ID{4}, parent: a2.id, height: 3, status: choices.Processing}
+
+	for _, blk := range []*testBlock{a1, a2, a3} {
+		wrapped := &BlockWrapper{Block: blk, cache: c}
+		c.verifiedBlocks[blk.id] = wrapped
+		if err := wrapped.Accept(); err != nil {
+			t.Fatalf("unexpected error accepting block: %s", err)
+		}
+	}
+
+	if c.LastAcceptedBlockInternal().ID() != a3.id {
+		t.Fatalf("expected last accepted block to be a3")
+	}
+
+	// Re-verify a1 and a2 so Reorg has something to reject on the stale
+	// fork, then rewind back to height 1 with a new tip b2.
+	c.verifiedBlocks[a1.id] = &BlockWrapper{Block: a1, cache: c}
+	c.verifiedBlocks[a2.id] = &BlockWrapper{Block: a2, cache: c}
+
+	b1 := &testBlock{id: ids.ID{5}, parent: genesis.id, height: 1, status: choices.Processing}
+	b2 := &testBlock{id: ids.ID{6}, parent: b1.id, height: 2, status: choices.Processing}
+
+	if err := c.Reorg(1, b2); err != nil {
+		t.Fatalf("unexpected error during reorg: %s", err)
+	}
+
+	if c.LastAcceptedBlockInternal().ID() != b2.id {
+		t.Fatalf("expected last accepted block to be b2 after reorg")
+	}
+	if _, ok := c.verifiedBlocks[a1.id]; ok {
+		t.Fatalf("expected a1 to be removed from verifiedBlocks after reorg")
+	}
+	if _, ok := c.verifiedBlocks[a2.id]; ok {
+		t.Fatalf("expected a2 to be removed from verifiedBlocks after reorg")
+	}
+	if a1.Status() != choices.Rejected {
+		t.Fatalf("expected a1 to be rejected, got %s", a1.Status())
+	}
+	if a2.Status() != choices.Rejected {
+		t.Fatalf("expected a2 to be rejected, got %s", a2.Status())
+	}
+
+	// a3, the old tip, was never re-verified, so the verified-block sweep
+	// doesn't reach it; Reorg must still mark it rejected in decidedBlocks,
+	// which is where GetBlockInternal finds it.
+	blk, err := c.GetBlockInternal(a3.id)
+	if err != nil {
+		t.Fatalf("unexpected error fetching a3: %s", err)
+	}
+	if blk.(*testBlock).Status() == choices.Accepted {
+		t.Fatalf("a3 should no longer report as accepted after the reorg past its height")
+	}
+}
+
+// TestReorgDoesNotRejectNewTip verifies that Reorg never runs the VM's
+// Reject side effects on [newTip] itself, even when the caller has already
+// inserted it into verifiedBlocks (i.e. "already verified", per Reorg's own
+// doc comment) at a height that would otherwise match the rejection sweep.
+func TestReorgDoesNotRejectNewTip(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   10,
+		LastAcceptedBlock:   genesis,
+	})
+
+	a1 := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	wrapped := &BlockWrapper{Block: a1, cache: c}
+	c.verifiedBlocks[a1.id] = wrapped
+	if err := wrapped.Accept(); err != nil {
+		t.Fatalf("unexpected error accepting block: %s", err)
+	}
+
+	// newTip is already verified and sitting in verifiedBlocks at
+	// fromHeight, matching the rejection sweep unless it's excluded.
+	newTip := &testBlock{id: ids.ID{3}, parent: genesis.id, height: 1, status: choices.Processing}
+	c.verifiedBlocks[newTip.id] = &BlockWrapper{Block: newTip, cache: c}
+
+	if err := c.Reorg(1, newTip); err != nil {
+		t.Fatalf("unexpected error during reorg: %s", err)
+	}
+
+	if newTip.Status() == choices.Rejected {
+		t.Fatalf("expected newTip to never have Reject called on it by its own Reorg")
+	}
+	if c.LastAcceptedBlockInternal().ID() != newTip.id {
+		t.Fatalf("expected last accepted block to be newTip after reorg")
+	}
+}
+
+// TestReject verifies that Reject moves a verified block to decidedBlocks
+// with status Rejected and evicts its accepted height index entry.
+func TestReject(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   10,
+		LastAcceptedBlock:   genesis,
+	})
+
+	blk := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	c.verifiedBlocks[blk.id] = &BlockWrapper{Block: blk, cache: c}
+	c.acceptedCache.Put(heightKey(blk.height), blk.id)
+
+	if err := c.Reject(blk.id); err != nil {
+		t.Fatalf("unexpected error rejecting block: %s", err)
+	}
+	if _, ok := c.verifiedBlocks[blk.id]; ok {
+		t.Fatalf("expected block to be removed from verifiedBlocks")
+	}
+	if blk.Status() != choices.Rejected {
+		t.Fatalf("expected block to be rejected, got %s", blk.Status())
+	}
+	if _, ok := c.decidedBlocks.Get(blk.id); !ok {
+		t.Fatalf("expected block to be present in decidedBlocks")
+	}
+	if _, ok := c.acceptedCache.Get(heightKey(blk.height)); ok {
+		t.Fatalf("expected the accepted height index entry to be evicted")
+	}
+}
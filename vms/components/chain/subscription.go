@@ -0,0 +1,170 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/consensus/snowman"
+)
+
+// subscriptionBufferSize bounds how many undelivered events a single
+// subscription will hold before the cache starts dropping on its behalf.
+const subscriptionBufferSize = 64
+
+// Subscription is a handle to an Accept/Reject subscription registered on a
+// Cache. Unsubscribe stops further delivery and releases the underlying
+// channel.
+type Subscription struct {
+	ch     chan snowman.Block
+	cache  *Cache
+	reject bool
+}
+
+// Events returns the channel blocks are delivered on. Consumers that fall
+// behind will have events silently dropped in favor of consensus progress;
+// see Cache.DroppedSubscriberEvents.
+func (s *Subscription) Events() <-chan snowman.Block { return s.ch }
+
+// Unsubscribe stops delivery to this subscription and releases its channel.
+func (s *Subscription) Unsubscribe() {
+	s.cache.subsLock.Lock()
+	defer s.cache.subsLock.Unlock()
+
+	subs := s.cache.acceptedSubs
+	if s.reject {
+		subs = s.cache.rejectedSubs
+	}
+	for i, sub := range subs {
+		if sub == s {
+			subs[i] = subs[len(subs)-1]
+			subs = subs[:len(subs)-1]
+			break
+		}
+	}
+	if s.reject {
+		s.cache.rejectedSubs = subs
+	} else {
+		s.cache.acceptedSubs = subs
+	}
+	close(s.ch)
+}
+
+// SubscribeAccepted returns a Subscription that receives every block
+// accepted by this Cache from this point forward.
+func (c *Cache) SubscribeAccepted() *Subscription {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+
+	sub := &Subscription{ch: make(chan snowman.Block, subscriptionBufferSize), cache: c}
+	c.acceptedSubs = append(c.acceptedSubs, sub)
+	return sub
+}
+
+// SubscribeRejected returns a Subscription that receives every block
+// rejected by this Cache from this point forward.
+func (c *Cache) SubscribeRejected() *Subscription {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+
+	sub := &Subscription{ch: make(chan snowman.Block, subscriptionBufferSize), cache: c, reject: true}
+	c.rejectedSubs = append(c.rejectedSubs, sub)
+	return sub
+}
+
+// Close unsubscribes and drains every outstanding subscription. It should be
+// called when the Cache itself is being torn down.
+func (c *Cache) Close() {
+	c.subsLock.Lock()
+	acceptedSubs := c.acceptedSubs
+	rejectedSubs := c.rejectedSubs
+	c.acceptedSubs = nil
+	c.rejectedSubs = nil
+	c.subsLock.Unlock()
+
+	for _, sub := range acceptedSubs {
+		close(sub.ch)
+	}
+	for _, sub := range rejectedSubs {
+		close(sub.ch)
+	}
+}
+
+// dispatch delivers [blk] to every subscription in [subs], incrementing
+// [c.droppedSubEvents] rather than blocking on a slow consumer. The caller
+// must hold [c.subsLock] for writing for the duration of this call, so
+// that [subs] can't be concurrently mutated by Unsubscribe out from under
+// an in-flight send to a channel it's about to close, and so that
+// [c.droppedSubEvents] is updated under the lock that guards it.
+func (c *Cache) dispatch(subs []*Subscription, blk snowman.Block) {
+	for _, sub := range subs {
+		select {
+		case sub.ch <- blk:
+		default:
+			c.droppedSubEvents++
+		}
+	}
+}
+
+// DroppedSubscriberEvents returns the number of events dropped so far
+// because a subscriber's buffer was full.
+func (c *Cache) DroppedSubscriberEvents() uint64 {
+	c.subsLock.RLock()
+	defer c.subsLock.RUnlock()
+	return c.droppedSubEvents
+}
+
+// dispatchAccepted notifies every accepted-subscription of [blk]. It is
+// called from BlockWrapper.Accept.
+func (c *Cache) dispatchAccepted(blk snowman.Block) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	c.dispatch(c.acceptedSubs, blk)
+}
+
+// dispatchRejected notifies every rejected-subscription of [blk]. It is
+// called from BlockWrapper.Reject.
+func (c *Cache) dispatchRejected(blk snowman.Block) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	c.dispatch(c.rejectedSubs, blk)
+}
+
+// LastAcceptedSince returns every accepted block from [height] (inclusive)
+// up to the current last accepted block, by walking the height->acceptedID
+// index and falling back to GetBlockIDAtHeight for heights evicted from it. It
+// lets a consumer that missed subscription events (e.g. because they were
+// dropped under load, or the consumer wasn't yet subscribed) catch back up
+// without needing its own chain scan.
+func (c *Cache) LastAcceptedSince(height uint64) ([]snowman.Block, error) {
+	lastAcceptedHeight := c.lastAcceptedBlock.Height()
+	if height > lastAcceptedHeight {
+		return nil, nil
+	}
+
+	blks := make([]snowman.Block, 0, lastAcceptedHeight-height+1)
+	for h := height; h <= lastAcceptedHeight; h++ {
+		key := heightKey(h)
+		acceptedID, ok := c.acceptedCache.Get(key)
+		if !ok {
+			if c.getBlockIDAtHeight == nil {
+				return nil, fmt.Errorf("accepted blockID at height %d has been evicted and no GetBlockIDAtHeight was configured to recover it", h)
+			}
+			var err error
+			acceptedID, err = c.getBlockIDAtHeight(h)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get accepted blockID at height %d: %w", h, err)
+			}
+			c.acceptedCache.Put(key, acceptedID)
+		}
+		blk, err := c.GetBlock(acceptedID.(ids.ID))
+		if err != nil {
+			return nil, err
+		}
+		blks = append(blks, blk)
+	}
+	return blks, nil
+}
@@ -0,0 +1,165 @@
+// (c) 2019-2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+)
+
+// TestSubscribeAccepted verifies that an accepted-subscription receives a
+// block accepted after subscribing and stops receiving events after
+// Unsubscribe.
+func TestSubscribeAccepted(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   10,
+		LastAcceptedBlock:   genesis,
+	})
+
+	sub := c.SubscribeAccepted()
+
+	blk := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	wrapped := &BlockWrapper{Block: blk, cache: c}
+	if err := wrapped.Accept(); err != nil {
+		t.Fatalf("unexpected error accepting block: %s", err)
+	}
+
+	select {
+	case got := <-sub.Events():
+		if got.ID() != blk.id {
+			t.Fatalf("expected to receive accepted block %s, got %s", blk.id, got.ID())
+		}
+	default:
+		t.Fatal("expected an accepted event to be delivered")
+	}
+
+	sub.Unsubscribe()
+
+	blk2 := &testBlock{id: ids.ID{3}, parent: blk.id, height: 2, status: choices.Processing}
+	wrapped2 := &BlockWrapper{Block: blk2, cache: c}
+	if err := wrapped2.Accept(); err != nil {
+		t.Fatalf("unexpected error accepting block: %s", err)
+	}
+
+	if _, ok := <-sub.Events(); ok {
+		t.Fatal("expected no further events after Unsubscribe")
+	}
+}
+
+// TestLastAcceptedSince verifies that a consumer that missed subscription
+// events can recover the accepted chain since a given height.
+func TestLastAcceptedSince(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   10,
+		LastAcceptedBlock:   genesis,
+	})
+
+	a1 := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	a2 := &testBlock{id: ids.ID{3}, parent: a1.id, height: 2, status: choices.Processing}
+	for _, blk := range []*testBlock{a1, a2} {
+		wrapped := &BlockWrapper{Block: blk, cache: c}
+		if err := wrapped.Accept(); err != nil {
+			t.Fatalf("unexpected error accepting block: %s", err)
+		}
+	}
+
+	blks, err := c.LastAcceptedSince(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(blks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blks))
+	}
+	if blks[0].ID() != a1.id || blks[1].ID() != a2.id {
+		t.Fatalf("expected [a1, a2], got [%s, %s]", blks[0].ID(), blks[1].ID())
+	}
+}
+
+// TestLastAcceptedSinceFallsBackOnCacheEviction verifies that once a
+// height's accepted-blockID entry has fallen out of acceptedCache (the
+// common case for a consumer that was slow to catch up), LastAcceptedSince
+// recovers it via GetBlockIDAtHeight instead of silently dropping it.
+func TestLastAcceptedSinceFallsBackOnCacheEviction(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	byHeight := map[uint64]ids.ID{genesis.height: genesis.id}
+
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   1,
+		LastAcceptedBlock:   genesis,
+		GetBlockIDAtHeight: func(h uint64) (ids.ID, error) {
+			id, ok := byHeight[h]
+			if !ok {
+				return ids.ID{}, fmt.Errorf("no accepted block recorded at height %d", h)
+			}
+			return id, nil
+		},
+	})
+
+	a1 := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	a2 := &testBlock{id: ids.ID{3}, parent: a1.id, height: 2, status: choices.Processing}
+	for _, blk := range []*testBlock{a1, a2} {
+		byHeight[blk.height] = blk.id
+		wrapped := &BlockWrapper{Block: blk, cache: c}
+		if err := wrapped.Accept(); err != nil {
+			t.Fatalf("unexpected error accepting block: %s", err)
+		}
+	}
+
+	// acceptedCache has size 1, so accepting a2 evicted a1's height entry.
+	if _, ok := c.acceptedCache.Get(heightKey(a1.height)); ok {
+		t.Fatal("expected a1's accepted height entry to have been evicted")
+	}
+
+	blks, err := c.LastAcceptedSince(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(blks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blks))
+	}
+	if blks[0].ID() != a1.id || blks[1].ID() != a2.id {
+		t.Fatalf("expected [a1, a2], got [%s, %s]", blks[0].ID(), blks[1].ID())
+	}
+}
+
+// TestLastAcceptedSinceErrorsWithoutFallback verifies that a cache miss on
+// an evicted height returns an error, rather than silently omitting that
+// height, when no GetBlockIDAtHeight was configured to recover it.
+func TestLastAcceptedSinceErrorsWithoutFallback(t *testing.T) {
+	genesis := &testBlock{id: ids.ID{1}, height: 0, status: choices.Accepted}
+	c := NewCache(&Config{
+		DecidedCacheSize:    10,
+		MissingCacheSize:    10,
+		UnverifiedCacheSize: 10,
+		AcceptedCacheSize:   1,
+		LastAcceptedBlock:   genesis,
+	})
+
+	a1 := &testBlock{id: ids.ID{2}, parent: genesis.id, height: 1, status: choices.Processing}
+	a2 := &testBlock{id: ids.ID{3}, parent: a1.id, height: 2, status: choices.Processing}
+	for _, blk := range []*testBlock{a1, a2} {
+		wrapped := &BlockWrapper{Block: blk, cache: c}
+		if err := wrapped.Accept(); err != nil {
+			t.Fatalf("unexpected error accepting block: %s", err)
+		}
+	}
+
+	if _, err := c.LastAcceptedSince(1); err == nil {
+		t.Fatal("expected an error recovering an evicted height with no GetBlockIDAtHeight configured")
+	}
+}